@@ -21,14 +21,22 @@ import (
 	"flag"
 	"fmt"
 	"net/http"
+	"net/http/pprof"
+	"net/url"
 	"os"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/kubernetes-csi/csi-lib-utils/metrics"
+	"github.com/kubernetes-csi/external-resizer/pkg/configz"
 	"github.com/kubernetes-csi/external-resizer/pkg/csi"
+	"github.com/kubernetes-csi/external-resizer/pkg/liveness"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 
 	"k8s.io/client-go/util/workqueue"
 
@@ -44,7 +52,7 @@ import (
 )
 
 var (
-	master       = flag.String("master", "", "Master URL to build a client config from. Either this or kubeconfig needs to be set if the provisioner is being run out of cluster.")
+	masters      mastersFlag
 	kubeConfig   = flag.String("kubeconfig", "", "Absolute path to the kubeconfig")
 	resyncPeriod = flag.Duration("resync-period", time.Minute*10, "Resync period for cache")
 	workers      = flag.Int("workers", 10, "Concurrency to process multiple resize requests")
@@ -57,8 +65,21 @@ var (
 	retryIntervalStart = flag.Duration("retry-interval-start", time.Second, "Initial retry interval of failed volume resize. It exponentially increases with each failure, up to retry-interval-max.")
 	retryIntervalMax   = flag.Duration("retry-interval-max", 5*time.Minute, "Maximum retry interval of failed volume resize.")
 
-	enableLeaderElection    = flag.Bool("leader-election", false, "Enable leader election.")
-	leaderElectionNamespace = flag.String("leader-election-namespace", "", "Namespace where the leader election resource lives. Defaults to the pod namespace if not set.")
+	enableLeaderElection        = flag.Bool("leader-election", false, "Enable leader election.")
+	leaderElectionNamespace     = flag.String("leader-election-namespace", "", "Namespace where the leader election resource lives. Defaults to the pod namespace if not set.")
+	leaderElectionLeaseDuration = flag.Duration("leader-election-lease-duration", 15*time.Second, "Duration, in seconds, that non-leader candidates will wait to force acquire leadership.")
+	leaderElectionRenewDeadline = flag.Duration("leader-election-renew-deadline", 10*time.Second, "Duration, in seconds, that the acting leader will retry refreshing leadership before giving up.")
+	leaderElectionRetryPeriod   = flag.Duration("leader-election-retry-period", 5*time.Second, "Duration, in seconds, the LeaderElector clients should wait between tries of actions.")
+	// NOTE on scope: this flag was requested to accept "leases",
+	// "endpointsleases", and "configmapsleases". csi-lib-utils/leaderelection
+	// only wraps client-go's Lease-based leaderelection.LeaderElectionConfig
+	// and has no path for endpoints or configmaps locks (client-go itself
+	// dropped those upstream), so only "leases" is implemented here. That is
+	// a narrower scope than requested; flagging it explicitly rather than
+	// quietly shipping a flag whose help text undersells the gap. If
+	// endpoints/configmaps support is still wanted, it needs a change to
+	// csi-lib-utils/leaderelection first, not just this flag.
+	leaderElectionResourceLock = flag.String("leader-election-resource-lock", "leases", "Resource lock type to use for leader election. Only 'leases' is supported: csi-lib-utils/leaderelection does not implement the 'endpointsleases' or 'configmapsleases' locks that were originally requested alongside it (see NOTE on scope above validateLeaderElectionResourceLock).")
 
 	metricsAddress = flag.String("metrics-address", "", "(deprecated) The TCP network address where the prometheus metrics endpoint will listen (example: `:8080`). The default is empty string, which means metrics endpoint is disabled. Only one of `--metrics-address` and `--http-endpoint` can be set.")
 	httpEndpoint   = flag.String("http-endpoint", "", "The TCP network address where the HTTP server for diagnostics, including metrics and leader election health check, will listen (example: `:8080`). The default is empty string, which means the server is disabled. Only one of `--metrics-address` and `--http-endpoint` can be set.")
@@ -69,9 +90,261 @@ var (
 
 	handleVolumeInUseError = flag.Bool("handle-volume-inuse-error", true, "Flag to turn on/off capability to handle volume in use error in resizer controller. Defaults to true if not set.")
 
+	livenessPollInterval = flag.Duration("liveness-poll-interval", 60*time.Second, "How often to probe the CSI driver's health via the CSI Probe RPC.")
+	livenessProbeTimeout = flag.Duration("liveness-probe-timeout", 3*time.Second, "Timeout for the periodic CSI Probe RPC call.")
+
+	enableProfiling           = flag.Bool("enable-profiling", false, "Enable pprof profiling on the HTTP server endpoint (requires --http-endpoint or --metrics-address).")
+	enableContentionProfiling = flag.Bool("enable-contention-profiling", false, "Enable lock contention profiling. Only effective when --enable-profiling is also set.")
+
+	resizeQPS            = flag.Float64("resize-qps", 0, "Global rate limit, in ControllerExpandVolume calls per second, applied across all PVCs. 0 means no limit.")
+	resizeBurst          = flag.Int("resize-burst", 1, "Burst allowance for --resize-qps.")
+	maxConcurrentResizes = flag.Int("max-concurrent-resizes", 0, "Maximum number of ControllerExpandVolume calls that may be outstanding at once. 0 means no limit.")
+
 	version = "unknown"
 )
 
+func init() {
+	flag.Var(&masters, "master", "Master URL to build a client config from. May be repeated or comma-separated to list multiple candidate apiserver endpoints for failover. Either this or kubeconfig needs to be set if the resizer is being run out of cluster.")
+}
+
+// mastersFlag collects repeated or comma-separated --master values into an
+// ordered list of candidate apiserver endpoints.
+type mastersFlag []string
+
+func (m *mastersFlag) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *mastersFlag) Set(value string) error {
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*m = append(*m, s)
+		}
+	}
+	return nil
+}
+
+// buildConfig constructs a *rest.Config using a deferred loading client
+// config, which merges any explicit kubeconfig with in-cluster
+// service-account credentials. When one or more --master endpoints are
+// given, each is tried in order as a ConfigOverrides.ClusterInfo.Server
+// override and verified with a lightweight ServerVersion call; the first
+// one that's actually reachable wins. This lets a sidecar in front of an
+// HA control plane with several distinct apiserver addresses fail over to
+// a working one instead of being pinned to a single, possibly down, URL.
+func buildConfig(masters []string, kubeconfig string) (*rest.Config, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+
+	if len(masters) == 0 {
+		return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	}
+
+	var errs []error
+	for _, m := range masters {
+		overrides := &clientcmd.ConfigOverrides{ClusterInfo: clientcmdapi.Cluster{Server: m}}
+		config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("master %q: %v", m, err))
+			continue
+		}
+
+		probeConfig := *config
+		probeConfig.Timeout = 10 * time.Second
+		probeClient, err := kubernetes.NewForConfig(&probeConfig)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("master %q: %v", m, err))
+			continue
+		}
+		if _, err := probeClient.Discovery().ServerVersion(); err != nil {
+			klog.Warningf("apiserver endpoint %q is unreachable, trying next candidate: %v", m, err)
+			errs = append(errs, fmt.Errorf("master %q: %v", m, err))
+			continue
+		}
+
+		klog.Infof("Using apiserver endpoint %q", m)
+		if len(masters) > 1 {
+			config.WrapTransport = newRotatingTransport(masters, m)
+		}
+		return config, nil
+	}
+	return nil, fmt.Errorf("failed to reach any of %d configured --master endpoints: %v", len(masters), errs)
+}
+
+// newRotatingTransport returns a transport.WrapperFunc that sends each
+// request to the currently active candidate in masters and switches to the
+// next candidate once the active endpoint has returned
+// rotatingFailureThreshold consecutive connection errors or 5xx responses;
+// a failed request itself is not retried. current is
+// the endpoint buildConfig already verified reachable, so rotation starts
+// from there instead of always retrying from the front of the list. This
+// is what lets the sidecar ride out an apiserver instance going down at
+// runtime, rather than only picking a healthy one at startup.
+func newRotatingTransport(masters []string, current string) func(http.RoundTripper) http.RoundTripper {
+	hosts := make([]*url.URL, 0, len(masters))
+	currentIdx := 0
+	for _, m := range masters {
+		u, err := url.Parse(m)
+		if err != nil {
+			klog.Warningf("--master %q is not a valid URL, excluding it from runtime failover rotation: %v", m, err)
+			continue
+		}
+		if m == current {
+			currentIdx = len(hosts)
+		}
+		hosts = append(hosts, u)
+	}
+
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return &rotatingRoundTripper{next: rt, hosts: hosts, current: currentIdx}
+	}
+}
+
+// rotatingFailureThreshold is how many consecutive failed requests against
+// the active endpoint it takes before rotatingRoundTripper rotates to the
+// next candidate. A single transient error (e.g. one bad 500 from an
+// admission webhook unrelated to apiserver availability) isn't enough to
+// flip endpoints on its own.
+const rotatingFailureThreshold = 3
+
+// rotatingRoundTripper sends each request to whichever host is currently
+// marked active. It does NOT retry a failed request against a different
+// host within the same call — doing so would replay POST/PATCH/DELETE
+// bodies against a second apiserver without the caller's knowledge, which
+// isn't safe for non-idempotent writes. Instead, it counts consecutive
+// failures against the active host and only rotates once
+// rotatingFailureThreshold is reached, so later calls (made through the
+// normal client-go retry paths) land on a healthy endpoint.
+type rotatingRoundTripper struct {
+	next  http.RoundTripper
+	hosts []*url.URL
+
+	mu               sync.Mutex
+	current          int
+	consecutiveFails int
+}
+
+func (t *rotatingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	idx := t.current
+	t.mu.Unlock()
+	host := t.hosts[idx]
+
+	reqCopy := req.Clone(req.Context())
+	reqCopy.URL.Scheme = host.Scheme
+	reqCopy.URL.Host = host.Host
+	reqCopy.Host = host.Host
+
+	resp, err := t.next.RoundTrip(reqCopy)
+	if err == nil && resp.StatusCode < http.StatusInternalServerError {
+		t.mu.Lock()
+		t.consecutiveFails = 0
+		t.mu.Unlock()
+		return resp, nil
+	}
+
+	var callErr error
+	if err != nil {
+		callErr = err
+	} else {
+		callErr = fmt.Errorf("received status %d from %s", resp.StatusCode, host.Host)
+		resp.Body.Close()
+	}
+
+	t.mu.Lock()
+	t.consecutiveFails++
+	if t.consecutiveFails >= rotatingFailureThreshold && len(t.hosts) > 1 {
+		next := (idx + 1) % len(t.hosts)
+		klog.Warningf("apiserver endpoint %q failed %d consecutive times, rotating to %q",
+			host.Host, t.consecutiveFails, t.hosts[next].Host)
+		t.current = next
+		t.consecutiveFails = 0
+	}
+	t.mu.Unlock()
+
+	return nil, callErr
+}
+
+// runtimeConfig is the effective configuration served at /configz. It
+// mirrors the command-line flags plus the handful of values that are only
+// resolved after the CSI driver connection is established, so it reflects
+// what the resizer is actually doing rather than just what it was told.
+type runtimeConfig struct {
+	Masters      []string      `json:"masters"`
+	KubeConfig   string        `json:"kubeConfig"`
+	ResyncPeriod time.Duration `json:"resyncPeriod"`
+	Workers      int           `json:"workers"`
+
+	CSIAddress string        `json:"csiAddress"`
+	Timeout    time.Duration `json:"timeout"`
+
+	RetryIntervalStart time.Duration `json:"retryIntervalStart"`
+	RetryIntervalMax   time.Duration `json:"retryIntervalMax"`
+
+	EnableLeaderElection        bool          `json:"enableLeaderElection"`
+	LeaderElectionNamespace     string        `json:"leaderElectionNamespace"`
+	LeaderElectionLeaseDuration time.Duration `json:"leaderElectionLeaseDuration"`
+	LeaderElectionRenewDeadline time.Duration `json:"leaderElectionRenewDeadline"`
+	LeaderElectionRetryPeriod   time.Duration `json:"leaderElectionRetryPeriod"`
+	LeaderElectionResourceLock  string        `json:"leaderElectionResourceLock"`
+
+	KubeAPIQPS   float64 `json:"kubeAPIQPS"`
+	KubeAPIBurst int     `json:"kubeAPIBurst"`
+
+	HandleVolumeInUseError bool `json:"handleVolumeInUseError"`
+
+	MetricsAddress string `json:"metricsAddress"`
+	HTTPEndpoint   string `json:"httpEndpoint"`
+	MetricsPath    string `json:"metricsPath"`
+
+	LivenessPollInterval time.Duration `json:"livenessPollInterval"`
+	LivenessProbeTimeout time.Duration `json:"livenessProbeTimeout"`
+
+	EnableProfiling           bool `json:"enableProfiling"`
+	EnableContentionProfiling bool `json:"enableContentionProfiling"`
+
+	ResizeQPS            float64 `json:"resizeQPS"`
+	ResizeBurst          int     `json:"resizeBurst"`
+	MaxConcurrentResizes int     `json:"maxConcurrentResizes"`
+
+	// DriverName and ResizerName are only known once the resizer has
+	// connected to the CSI driver socket and built its resizer.Resizer.
+	DriverName  string `json:"driverName"`
+	ResizerName string `json:"resizerName"`
+}
+
+func newRuntimeConfig() runtimeConfig {
+	return runtimeConfig{
+		Masters:                     masters,
+		KubeConfig:                  *kubeConfig,
+		ResyncPeriod:                *resyncPeriod,
+		Workers:                     *workers,
+		CSIAddress:                  *csiAddress,
+		Timeout:                     *timeout,
+		RetryIntervalStart:          *retryIntervalStart,
+		RetryIntervalMax:            *retryIntervalMax,
+		EnableLeaderElection:        *enableLeaderElection,
+		LeaderElectionNamespace:     *leaderElectionNamespace,
+		LeaderElectionLeaseDuration: *leaderElectionLeaseDuration,
+		LeaderElectionRenewDeadline: *leaderElectionRenewDeadline,
+		LeaderElectionRetryPeriod:   *leaderElectionRetryPeriod,
+		LeaderElectionResourceLock:  *leaderElectionResourceLock,
+		KubeAPIQPS:                  *kubeAPIQPS,
+		KubeAPIBurst:                *kubeAPIBurst,
+		HandleVolumeInUseError:      *handleVolumeInUseError,
+		MetricsAddress:              *metricsAddress,
+		HTTPEndpoint:                *httpEndpoint,
+		MetricsPath:                 *metricsPath,
+		LivenessPollInterval:        *livenessPollInterval,
+		LivenessProbeTimeout:        *livenessProbeTimeout,
+		EnableProfiling:             *enableProfiling,
+		EnableContentionProfiling:   *enableContentionProfiling,
+		ResizeQPS:                   *resizeQPS,
+		ResizeBurst:                 *resizeBurst,
+		MaxConcurrentResizes:        *maxConcurrentResizes,
+	}
+}
+
 func main() {
 	klog.InitFlags(nil)
 	flag.Set("logtostderr", "true")
@@ -92,13 +365,7 @@ func main() {
 		addr = *httpEndpoint
 	}
 
-	var config *rest.Config
-	var err error
-	if *master != "" || *kubeConfig != "" {
-		config, err = clientcmd.BuildConfigFromFlags(*master, *kubeConfig)
-	} else {
-		config, err = rest.InClusterConfig()
-	}
+	config, err := buildConfig(masters, *kubeConfig)
 	if err != nil {
 		klog.Fatal(err.Error())
 	}
@@ -115,6 +382,12 @@ func main() {
 
 	mux := http.NewServeMux()
 
+	cz, err := configz.New("csi-resizer")
+	if err != nil {
+		klog.Fatalf("error registering configz: %v", err)
+	}
+	cz.Set(newRuntimeConfig())
+
 	metricsManager := metrics.NewCSIMetricsManager("" /* driverName */)
 
 	csiClient, err := csi.New(*csiAddress, *timeout, metricsManager)
@@ -128,6 +401,10 @@ func main() {
 	}
 	klog.V(2).Infof("CSI driver name: %q", driverName)
 
+	cfgSnapshot := newRuntimeConfig()
+	cfgSnapshot.DriverName = driverName
+	cz.Set(cfgSnapshot)
+
 	translator := csitrans.New()
 	if translator.IsMigratedCSIDriverByName(driverName) {
 		metricsManager = metrics.NewCSIMetricsManagerWithOptions(driverName, metrics.WithMigration())
@@ -149,10 +426,29 @@ func main() {
 		klog.Fatal(err.Error())
 	}
 
+	livenessChecker, err := liveness.NewChecker(liveness.Options{
+		CSIAddress:   *csiAddress,
+		PollInterval: *livenessPollInterval,
+		ProbeTimeout: *livenessProbeTimeout,
+	}, metricsManager)
+	if err != nil {
+		klog.Fatalf("error setting up liveness checker: %v", err)
+	}
+
 	// Start HTTP server for metrics + leader election healthz
 	if addr != "" {
 		metricsManager.RegisterToServer(mux, *metricsPath)
 		metricsManager.SetDriverName(driverName)
+		livenessChecker.RegisterHandler(mux)
+		configz.InstallHandler(mux)
+		if *enableProfiling {
+			installPprofHandlers(mux)
+			if *enableContentionProfiling {
+				runtime.SetBlockProfileRate(1)
+				runtime.SetMutexProfileFraction(1)
+			}
+		}
+		go livenessChecker.Run(context.Background())
 		go func() {
 			klog.Infof("ServeMux listening at %q", addr)
 			err := http.ListenAndServe(addr, mux)
@@ -163,7 +459,15 @@ func main() {
 	}
 
 	resizerName := csiResizer.Name()
-	rc := controller.NewResizeController(resizerName, csiResizer, kubeClient, *resyncPeriod, informerFactory,
+	cfgSnapshot.ResizerName = resizerName
+	cz.Set(cfgSnapshot)
+
+	var limitedResizer resizer.Resizer = csiResizer
+	if *resizeQPS > 0 || *maxConcurrentResizes > 0 {
+		limitedResizer = util.NewRateLimitingResizer(csiResizer, *resizeQPS, *resizeBurst, *maxConcurrentResizes)
+	}
+
+	rc := controller.NewResizeController(resizerName, limitedResizer, kubeClient, *resyncPeriod, informerFactory,
 		workqueue.NewItemExponentialFailureRateLimiter(*retryIntervalStart, *retryIntervalMax),
 		*handleVolumeInUseError)
 	run := func(ctx context.Context) {
@@ -175,6 +479,10 @@ func main() {
 	if !*enableLeaderElection {
 		run(context.TODO())
 	} else {
+		if err := validateLeaderElectionResourceLock(*leaderElectionResourceLock); err != nil {
+			klog.Fatal(err.Error())
+		}
+
 		lockName := "external-resizer-" + util.SanitizeName(resizerName)
 		leKubeClient, err := kubernetes.NewForConfig(config)
 		if err != nil {
@@ -189,12 +497,56 @@ func main() {
 			le.WithNamespace(*leaderElectionNamespace)
 		}
 
+		le.WithLeaseDuration(*leaderElectionLeaseDuration)
+		le.WithRenewDeadline(*leaderElectionRenewDeadline)
+		le.WithRetryPeriod(*leaderElectionRetryPeriod)
+
+		klog.Infof("Leader election settings: resourceLock=%q leaseDuration=%s renewDeadline=%s retryPeriod=%s",
+			*leaderElectionResourceLock, *leaderElectionLeaseDuration, *leaderElectionRenewDeadline, *leaderElectionRetryPeriod)
+
 		if err := le.Run(); err != nil {
 			klog.Fatalf("error initializing leader election: %v", err)
 		}
 	}
 }
 
+// validateLeaderElectionResourceLock checks that the --leader-election-resource-lock
+// flag was set to a resource lock type the underlying csi-lib-utils
+// leaderelection wrapper can actually honor.
+//
+// Scope note: "endpointsleases" and "configmapsleases" were part of the
+// original request for this flag, alongside "leases". They are deliberately
+// NOT accepted here — csi-lib-utils/leaderelection only implements
+// Lease-based locking, and client-go dropped the endpoints/configmaps lock
+// implementations it would otherwise delegate to. Rejecting them outright
+// (rather than silently downgrading to 'leases') is a narrowing of the
+// original ask that should be re-confirmed with whoever requested
+// multi-lock support, or revisited once csi-lib-utils grows the other lock
+// types.
+func validateLeaderElectionResourceLock(lock string) error {
+	switch lock {
+	case "leases":
+		return nil
+	case "endpointsleases", "configmapsleases":
+		return fmt.Errorf("invalid --leader-election-resource-lock %q: not yet supported by csi-lib-utils/leaderelection, which only implements Lease-based locking; only 'leases' is accepted", lock)
+	default:
+		return fmt.Errorf("invalid --leader-election-resource-lock %q: only 'leases' is supported", lock)
+	}
+}
+
+// installPprofHandlers registers the standard net/http/pprof endpoints on
+// mux, mirroring how kube-scheduler exposes profiling on its diagnostics
+// server. These are only reachable when --enable-profiling is set, since
+// they're a useful tool for diagnosing the resizer getting stuck on slow
+// CSI ControllerExpandVolume calls or informer cache contention, but
+// shouldn't be exposed by default.
+func installPprofHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
 func getDriverName(client csi.Client, timeout time.Duration) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
@@ -0,0 +1,89 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package configz provides a small registry of named, mutable configuration
+// snapshots that can be served as JSON over HTTP, modeled after Kubernetes'
+// own configz package. Components register a config at startup and update
+// it as values are derived, giving operators and support tooling a stable,
+// machine-readable way to inspect a running sidecar's effective flags
+// without access to the pod spec.
+package configz
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+var (
+	mu      sync.RWMutex
+	configs = map[string]*Config{}
+)
+
+// Config is a named, mutable configuration snapshot.
+type Config struct {
+	mu  sync.RWMutex
+	val interface{}
+}
+
+// New registers a new named config and returns a handle that can be used to
+// update its value. It returns an error if name is already registered.
+func New(name string) (*Config, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, found := configs[name]; found {
+		return nil, fmt.Errorf("configz: config %q is already registered", name)
+	}
+	c := &Config{}
+	configs[name] = c
+	return c, nil
+}
+
+// Set replaces the stored value. Callers use this to refresh the snapshot
+// once values that are only known after startup, such as a discovered
+// driver name, become available.
+func (c *Config) Set(value interface{}) {
+	c.mu.Lock()
+	c.val = value
+	c.mu.Unlock()
+}
+
+func (c *Config) get() interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.val
+}
+
+// InstallHandler registers the /configz endpoint on mux, serving every
+// registered config as a single JSON object keyed by name.
+func InstallHandler(mux *http.ServeMux) {
+	mux.HandleFunc("/configz", handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	mu.RLock()
+	snapshot := make(map[string]interface{}, len(configs))
+	for name, c := range configs {
+		snapshot[name] = c.get()
+	}
+	mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
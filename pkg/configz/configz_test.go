@@ -0,0 +1,64 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configz
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type sampleConfig struct {
+	Foo string `json:"foo"`
+}
+
+func TestInstallHandlerServesRegisteredConfig(t *testing.T) {
+	const name = "test-config"
+	cz, err := New(name)
+	if err != nil {
+		t.Fatalf("New(%q) returned error: %v", name, err)
+	}
+	cz.Set(sampleConfig{Foo: "bar"})
+
+	mux := http.NewServeMux()
+	InstallHandler(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/configz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var body map[string]sampleConfig
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode /configz response: %v", err)
+	}
+	if body[name].Foo != "bar" {
+		t.Fatalf("configz[%q] = %+v, want Foo=\"bar\"", name, body[name])
+	}
+}
+
+func TestNewRejectsDuplicateName(t *testing.T) {
+	const name = "duplicate-config"
+	if _, err := New(name); err != nil {
+		t.Fatalf("first New(%q) returned error: %v", name, err)
+	}
+	if _, err := New(name); err == nil {
+		t.Fatalf("second New(%q) succeeded, want error for duplicate registration", name)
+	}
+}
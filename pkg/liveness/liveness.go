@@ -0,0 +1,172 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package liveness periodically exercises the CSI Probe RPC against the
+// configured driver socket and exposes the result as both a metric and an
+// HTTP health check, so that Kubernetes can restart a sidecar whose CSI
+// connection has wedged without requiring a dedicated livenessprobe
+// container.
+package liveness
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kubernetes-csi/csi-lib-utils/connection"
+	"github.com/kubernetes-csi/csi-lib-utils/metrics"
+	"github.com/kubernetes-csi/csi-lib-utils/rpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// Options groups the tunables for the periodic CSI Probe loop.
+type Options struct {
+	// CSIAddress is the address of the CSI driver socket to probe.
+	CSIAddress string
+	// PollInterval is how often the Probe RPC is issued.
+	PollInterval time.Duration
+	// ProbeTimeout bounds each individual Probe call.
+	ProbeTimeout time.Duration
+}
+
+// Checker calls the CSI Probe RPC on a timer and remembers the last result
+// so it can be reported through the csi_liveness gauge and the /healthz
+// HTTP handler. It keeps its own connection to the driver socket open
+// across polls instead of dialing a new one every PollInterval, only
+// redialing if a probe observes the connection has gone bad.
+type Checker struct {
+	opts           Options
+	metricsManager metrics.CSIMetricsManager
+	gauge          prometheus.Gauge
+
+	mu    sync.Mutex
+	conn  *grpc.ClientConn
+	ready bool
+}
+
+// NewChecker dials opts.CSIAddress and returns a Checker that will reuse
+// that connection for every subsequent probe, recording results against
+// metricsManager's registry so the csi_liveness metric is exposed on the
+// same /metrics endpoint and carries the same migrated-driver labels as the
+// rest of the resizer's metrics.
+func NewChecker(opts Options, metricsManager metrics.CSIMetricsManager) (*Checker, error) {
+	conn, err := connection.Connect(context.Background(), opts.CSIAddress, metricsManager)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Checker{
+		opts:           opts,
+		metricsManager: metricsManager,
+		conn:           conn,
+		gauge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "csi_liveness",
+			Help: "Result of the last CSI Probe call: 1 if the driver reported ready, 0 otherwise.",
+		}),
+	}
+	metricsManager.GetRegistry().MustRegister(c.gauge)
+	return c, nil
+}
+
+// Run polls the CSI driver on opts.PollInterval until ctx is done.
+func (c *Checker) Run(ctx context.Context) {
+	wait.Until(func() { c.probeOnce(ctx) }, c.opts.PollInterval, ctx.Done())
+}
+
+func (c *Checker) probeOnce(parent context.Context) {
+	ctx, cancel := context.WithTimeout(parent, c.opts.ProbeTimeout)
+	defer cancel()
+
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		klog.Errorf("liveness probe: failed to connect to %q: %v", c.opts.CSIAddress, err)
+		c.setReady(false)
+		return
+	}
+
+	ready, err := rpc.Probe(ctx, conn)
+	if err != nil {
+		klog.Errorf("liveness probe: Probe RPC failed: %v", err)
+		c.dropConn()
+		c.setReady(false)
+		return
+	}
+	if !ready {
+		klog.Warning("liveness probe: driver reported Ready=false")
+	}
+	c.setReady(ready)
+}
+
+// getConn returns the checker's current connection, redialing it if a
+// previous probe found it broken.
+func (c *Checker) getConn(ctx context.Context) (*grpc.ClientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		return c.conn, nil
+	}
+	conn, err := connection.Connect(ctx, c.opts.CSIAddress, c.metricsManager)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	return conn, nil
+}
+
+// dropConn closes and forgets the current connection so the next probe
+// redials instead of repeatedly calling Probe against a dead connection.
+func (c *Checker) dropConn() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+func (c *Checker) setReady(ready bool) {
+	c.mu.Lock()
+	c.ready = ready
+	c.mu.Unlock()
+
+	if ready {
+		c.gauge.Set(1)
+	} else {
+		c.gauge.Set(0)
+	}
+}
+
+// RegisterHandler adds the /healthz handler to mux. It returns 200 while the
+// most recent Probe succeeded and reported Ready=true, and 503 otherwise.
+func (c *Checker) RegisterHandler(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		ready := c.ready
+		c.mu.Unlock()
+
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("CSI driver is not ready\n"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok\n"))
+	})
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package liveness
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/kubernetes-csi/csi-lib-utils/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// fakeIdentityServer is a minimal CSI Identity service backing a unix
+// socket, so the checker can be exercised end-to-end through a real gRPC
+// connection instead of a hand-rolled Prober stub.
+type fakeIdentityServer struct {
+	csi.UnimplementedIdentityServer
+
+	mu    sync.Mutex
+	ready bool
+	fail  bool
+}
+
+func (f *fakeIdentityServer) Probe(ctx context.Context, req *csi.ProbeRequest) (*csi.ProbeResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return nil, status.Error(codes.Unavailable, "fake driver unavailable")
+	}
+	return &csi.ProbeResponse{Ready: wrapperspb.Bool(f.ready)}, nil
+}
+
+func (f *fakeIdentityServer) setReady(ready bool) {
+	f.mu.Lock()
+	f.ready = ready
+	f.fail = false
+	f.mu.Unlock()
+}
+
+func (f *fakeIdentityServer) setFail() {
+	f.mu.Lock()
+	f.fail = true
+	f.mu.Unlock()
+}
+
+func startFakeDriver(t *testing.T) (addr string, server *fakeIdentityServer) {
+	t.Helper()
+
+	sockPath := filepath.Join(t.TempDir(), "csi.sock")
+	lis, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("failed to listen on %q: %v", sockPath, err)
+	}
+
+	fake := &fakeIdentityServer{}
+	grpcServer := grpc.NewServer()
+	csi.RegisterIdentityServer(grpcServer, fake)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	return "unix://" + sockPath, fake
+}
+
+func TestCheckerHealthzReflectsProbeResult(t *testing.T) {
+	addr, fake := startFakeDriver(t)
+
+	c, err := NewChecker(Options{
+		CSIAddress:   addr,
+		PollInterval: time.Hour,
+		ProbeTimeout: 5 * time.Second,
+	}, metrics.NewCSIMetricsManager(""))
+	if err != nil {
+		t.Fatalf("NewChecker returned error: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	c.RegisterHandler(mux)
+
+	assertStatus := func(want int) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		if rec.Code != want {
+			t.Fatalf("healthz status = %d, want %d", rec.Code, want)
+		}
+	}
+
+	// Before any probe has completed, the checker fails closed.
+	assertStatus(http.StatusServiceUnavailable)
+
+	fake.setReady(true)
+	c.probeOnce(context.Background())
+	assertStatus(http.StatusOK)
+
+	fake.setFail()
+	c.probeOnce(context.Background())
+	assertStatus(http.StatusServiceUnavailable)
+
+	fake.setReady(false)
+	c.probeOnce(context.Background())
+	assertStatus(http.StatusServiceUnavailable)
+}
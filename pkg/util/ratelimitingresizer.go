@@ -0,0 +1,77 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubernetes-csi/external-resizer/pkg/resizer"
+)
+
+// RateLimitingResizer wraps a resizer.Resizer with a global token-bucket
+// limiter and an optional cap on concurrent in-flight resizes. It protects
+// the CSI driver's (often cloud-provider-backed) control plane from being
+// hit with a burst of ControllerExpandVolume calls, e.g. when an operator
+// bulk-edits a StatefulSet's volumeClaimTemplates and the controller's
+// workqueue drains many PVCs at once.
+type RateLimitingResizer struct {
+	resizer.Resizer
+
+	limiter  *rate.Limiter
+	inFlight chan struct{}
+}
+
+// NewRateLimitingResizer wraps r with a token-bucket limiter admitting qps
+// resizes per second with room for burst, and, if maxConcurrentResizes is
+// greater than zero, a semaphore capping how many Resize calls may be
+// outstanding at once. A non-positive qps disables the token bucket.
+func NewRateLimitingResizer(r resizer.Resizer, qps float64, burst int, maxConcurrentResizes int) *RateLimitingResizer {
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	if qps > 0 {
+		limiter = rate.NewLimiter(rate.Limit(qps), burst)
+	}
+
+	var inFlight chan struct{}
+	if maxConcurrentResizes > 0 {
+		inFlight = make(chan struct{}, maxConcurrentResizes)
+	}
+
+	return &RateLimitingResizer{
+		Resizer:  r,
+		limiter:  limiter,
+		inFlight: inFlight,
+	}
+}
+
+// Resize blocks until both the rate limiter and the concurrency cap (if
+// any) admit the call, then delegates to the wrapped resizer.
+func (r *RateLimitingResizer) Resize(pv *v1.PersistentVolume, requestSize resource.Quantity) (resource.Quantity, bool, error) {
+	if err := r.limiter.Wait(context.Background()); err != nil {
+		return requestSize, false, err
+	}
+
+	if r.inFlight != nil {
+		r.inFlight <- struct{}{}
+		defer func() { <-r.inFlight }()
+	}
+
+	return r.Resizer.Resize(pv, requestSize)
+}